@@ -0,0 +1,107 @@
+package main
+
+/* config.go resolves ght's configuration from ~/.ght.
+ *
+ * ~/.ght can either be a bare GitHub Personal API token (the original
+ * format), or a small YAML document describing one or more named host
+ * profiles, for users who need to talk to a GitHub Enterprise Server
+ * instance as well as github.com:
+ *
+ *	token: abc123
+ *	endpoint: https://ghe.example.com/api/graphql
+ *	upload_url: https://ghe.example.com/api/uploads
+ *	hosts:
+ *	  work:
+ *	    token: def456
+ *	    endpoint: https://ghe.example.com/api/graphql
+ *
+ * GHT_TOKEN and GHT_ENDPOINT override whatever is found in ~/.ght.
+ */
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"gopkg.in/yaml.v3"
+)
+
+// hostProfile is a single named set of credentials in ~/.ght.
+type hostProfile struct {
+	Token     string `yaml:"token"`
+	Endpoint  string `yaml:"endpoint"`
+	UploadURL string `yaml:"upload_url"`
+}
+
+// ghtConfig is the parsed shape of ~/.ght when it's a YAML document.
+type ghtConfig struct {
+	hostProfile `yaml:",inline"`
+	Hosts       map[string]hostProfile `yaml:"hosts"`
+}
+
+/* loadConfig resolves ~/.ght, the GHT_TOKEN/GHT_ENDPOINT env vars, and an
+ * optional --host profile into the token and endpoint to use. endpoint is ""
+ * for the public github.com API. */
+func loadConfig(host string) (token string, endpoint string, err error) {
+	usr, err := user.Current()
+	if err != nil {
+		return "", "", err
+	}
+
+	path := filepath.Join(usr.HomeDir, ".ght")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", "", fmt.Errorf("ght. Missing '%s' file. This should contain your GitHub Personal API token. See https://blog.github.com/2013-05-16-personal-api-tokens/", path)
+		}
+		return "", "", fmt.Errorf("ght. Error reading file '%s', error: %s", path, err)
+	}
+
+	var cfg ghtConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil || (cfg.Token == "" && len(cfg.Hosts) == 0) {
+		// Not a recognisable YAML config: treat the whole file as a bare
+		// token, the original ~/.ght format. It has no host profiles, so
+		// --host can't be honoured.
+		if host != "" {
+			return "", "", fmt.Errorf("ght. --host '%s' requested but '%s' has no host profiles", host, path)
+		}
+		token = strings.TrimSpace(string(data))
+	} else {
+		profile := cfg.hostProfile
+		if host != "" {
+			var ok bool
+			profile, ok = cfg.Hosts[host]
+			if !ok {
+				return "", "", fmt.Errorf("ght. No host profile '%s' found in '%s'", host, path)
+			}
+		}
+		token, endpoint = profile.Token, profile.Endpoint
+	}
+
+	if v := os.Getenv("GHT_TOKEN"); v != "" {
+		token = v
+	}
+	if v := os.Getenv("GHT_ENDPOINT"); v != "" {
+		endpoint = v
+	}
+
+	if token == "" {
+		return "", "", fmt.Errorf("ght. No token configured in '%s'", path)
+	}
+	return token, endpoint, nil
+}
+
+/* newTokenClient returns an http.Client that authenticates every request with
+ * the given token, for use with both the GraphQL and REST APIs. */
+func newTokenClient(token string) *http.Client {
+	ts := oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: token},
+	)
+	return oauth2.NewClient(context.Background(), ts)
+}
@@ -1,6 +1,8 @@
 package main
 
-/* ght is the 'GitHub Tool', s read only tool for displaying information about github repos
+/* ght is the 'GitHub Tool', a tool for displaying information about github repos.
+ * It is read only, with the sole exception of `ght release edit`, which is an
+ * opt-in command that writes a release body back to GitHub.
  *
  * See:
  * - https://developer.github.com/v4/explorer/
@@ -14,12 +16,8 @@ import (
 	"github.com/gosuri/uitable"
 	"github.com/shurcooL/githubv4"
 	"github.com/wzshiming/ctc"
-	"golang.org/x/oauth2"
-	"io/ioutil"
 	"log"
 	"os"
-	"os/user"
-	"path/filepath"
 	"strings"
 	"time"
 )
@@ -36,21 +34,41 @@ The commands are:
 
 	repos           list the repositories
 	repo            summarise a single repository
+	relnotes        draft release notes between two tags
+	release edit    publish rendered release notes to a GitHub Release
 	help            show this help
 	help [command]  show help for command
 
 Configuration:
 
 	Requires a GitHub Personal API token (https://blog.github.com/2013-05-16-personal-api-tokens/)
-	in file ~/.ght with rights to access the repositories in question.
+	in file ~/.ght with rights to access the repositories in question. ~/.ght may
+	also be a YAML document with 'token', 'endpoint' and named 'hosts' profiles,
+	for talking to a GitHub Enterprise Server instance; see --host. GHT_TOKEN and
+	GHT_ENDPOINT override whatever is configured in ~/.ght.
 `
 )
 
 // Repository is the GitHub representation of a repository
 type Repository struct {
-	Name          string
-	NameWithOwner string
-	Url           string
+	Name            string
+	NameWithOwner   string
+	Url             string
+	IsArchived      bool
+	IsPrivate       bool
+	IsFork          bool
+	StargazerCount  int
+	PushedAt        githubv4.DateTime
+	PrimaryLanguage struct {
+		Name string
+	}
+	RepositoryTopics struct {
+		Nodes []struct {
+			Topic struct {
+				Name string
+			}
+		}
+	} `graphql:"repositoryTopics(first: 10)"`
 }
 
 // Release is the GitHub representation of a release, see https://help.github.com/categories/releases/
@@ -79,7 +97,7 @@ type QueryReposByUser struct {
 				EndCursor   githubv4.String
 				HasNextPage bool
 			}
-		} `graphql:"repositories(first: 100, after: $repositoriesCursor)"` // 100 per page.
+		} `graphql:"repositories(first: 100, after: $repositoriesCursor, privacy: $privacy, affiliations: $affiliations, orderBy: {field: $orderField, direction: $orderDirection})"` // 100 per page.
 	} `graphql:"user(login: $login)"`
 }
 
@@ -93,7 +111,7 @@ type QueryReposByOrg struct {
 				EndCursor   githubv4.String
 				HasNextPage bool
 			}
-		} `graphql:"repositories(first: 100, after: $repositoriesCursor)"` // 100 per page.
+		} `graphql:"repositories(first: 100, after: $repositoriesCursor, privacy: $privacy, orderBy: {field: $orderField, direction: $orderDirection})"` // 100 per page.
 	} `graphql:"organization(login: $login)"`
 }
 
@@ -147,6 +165,15 @@ func main() {
 	reposCommand := flag.NewFlagSet("repos", flag.ExitOnError)
 	orgPtr := reposCommand.String("o", "", "Specify the GitHub organisation")
 	userPtr := reposCommand.String("u", "", "Specify the GitHub user")
+	reposFormatPtr := reposCommand.String("format", formatTable, "Output format: table, json or yaml")
+	reposHostPtr := reposCommand.String("host", "", "Name of the host profile to use from ~/.ght")
+	visibilityPtr := reposCommand.String("visibility", "all", "Filter by visibility: all, public or private")
+	affiliationPtr := reposCommand.String("affiliation", "", "Comma separated affiliations: owner, collaborator, organization_member (user only)")
+	includeArchivedPtr := reposCommand.Bool("include-archived", false, "Include archived repositories")
+	languagePtr := reposCommand.String("language", "", "Filter by primary language, e.g. Go")
+	topicPtr := reposCommand.String("topic", "", "Filter by repository topic, e.g. cli")
+	pushedSincePtr := reposCommand.String("pushed-since", "", "Only include repositories pushed to since this date, e.g. 2024-01-01")
+	sortPtr := reposCommand.String("sort", "name", "Sort order: name, pushed or stars")
 
 	repoCommand := flag.NewFlagSet("repo", flag.ExitOnError)
 	maxReleasesPtr := repoCommand.Int("maxr", 20, "Specify the maximum number of Releases to display, up to 100.")
@@ -154,12 +181,29 @@ func main() {
 	showDescriptionPtr := repoCommand.Bool("desc", false, "Display the Release description")
 	showChangelogPtr := repoCommand.Bool("changelog", false, "Change to output format to display something like a traditional changelog")
 	printColorPtr := repoCommand.Bool("color", false, "Print the changelog in color")
+	repoFormatPtr := repoCommand.String("format", formatTable, "Output format: table, json or yaml")
+	repoHostPtr := repoCommand.String("host", "", "Name of the host profile to use from ~/.ght")
+
+	relnotesCommand := flag.NewFlagSet("relnotes", flag.ExitOnError)
+	fromPtr := relnotesCommand.String("from", "", "Tag or ref to start the release notes from")
+	toPtr := relnotesCommand.String("to", "", "Tag or ref to end the release notes at, defaults to HEAD of the default branch")
+	labelMapPtr := relnotesCommand.String("label-map", "", "Path to a YAML file overriding the default label-to-heading map")
+	skipLabelPtr := relnotesCommand.String("skip-label", "", "Comma separated list of labels that exclude a PR from the notes, e.g. release-note-none")
+	relnotesFormatPtr := relnotesCommand.String("format", formatTable, "Output format: table (rendered Markdown), json or yaml")
+	relnotesHostPtr := relnotesCommand.String("host", "", "Name of the host profile to use from ~/.ght")
+
+	releaseEditCommand := flag.NewFlagSet("release edit", flag.ExitOnError)
+	releaseTagPtr := releaseEditCommand.String("tag", "", "The tag of the release to edit")
+	releaseDryRunPtr := releaseEditCommand.Bool("dry-run", false, "Print the diff of the old and new body without publishing it")
+	releaseCreatePtr := releaseEditCommand.Bool("create", false, "Create the release if it doesn't already exist")
+	releaseFromFilePtr := releaseEditCommand.String("from-file", "", "Read the release body from this file instead of rendering the changelog")
+	releaseHostPtr := releaseEditCommand.String("host", "", "Name of the host profile to use from ~/.ght")
 
 	// Verify that a subcommand has been provided
 	// os.Arg[0] is the main command
 	// os.Arg[1] will be the subcommand
 	if len(os.Args) < 2 {
-		log.Println(helptext)
+		log.Print(helptext)
 		os.Exit(1)
 	}
 	// Switch on the subcommand
@@ -171,31 +215,63 @@ func main() {
 		if len(os.Args) > 2 {
 			switch os.Args[2] {
 			case "repos":
-				err = doListRepos(reposCommand, orgPtr, userPtr, true)
+				err = doListRepos(reposCommand, orgPtr, userPtr, reposFormatPtr, reposHostPtr, visibilityPtr, affiliationPtr, includeArchivedPtr, languagePtr, topicPtr, pushedSincePtr, sortPtr, true)
 
 			case "repo":
-				err = doRepo(repoCommand, maxReleasesPtr, maxTagsPtr, showDescriptionPtr, showChangelogPtr, printColorPtr, true)
+				err = doRepo(repoCommand, maxReleasesPtr, maxTagsPtr, showDescriptionPtr, showChangelogPtr, printColorPtr, repoFormatPtr, repoHostPtr, true)
+
+			case "relnotes":
+				err = doRelNotes(relnotesCommand, fromPtr, toPtr, labelMapPtr, skipLabelPtr, relnotesFormatPtr, relnotesHostPtr, true)
+
+			case "release":
+				err = doReleaseEdit(releaseEditCommand, releaseTagPtr, releaseDryRunPtr, releaseCreatePtr, releaseFromFilePtr, releaseHostPtr, true)
 
 			default:
 				log.Printf("Help unknown command '%s'", os.Args[2])
-				log.Println(helptext)
+				log.Print(helptext)
 				os.Exit(1)
 
 			}
 		} else {
-			log.Println(helptext)
+			log.Print(helptext)
 		}
 	case "repos":
 		reposCommand.Parse(os.Args[2:])
-		err = doListRepos(reposCommand, orgPtr, userPtr, false)
+		err = doListRepos(reposCommand, orgPtr, userPtr, reposFormatPtr, reposHostPtr, visibilityPtr, affiliationPtr, includeArchivedPtr, languagePtr, topicPtr, pushedSincePtr, sortPtr, false)
 
 	case "repo":
 		repoCommand.Parse(os.Args[3:])
-		err = doRepo(repoCommand, maxReleasesPtr, maxTagsPtr, showDescriptionPtr, showChangelogPtr, printColorPtr, false)
+		err = doRepo(repoCommand, maxReleasesPtr, maxTagsPtr, showDescriptionPtr, showChangelogPtr, printColorPtr, repoFormatPtr, repoHostPtr, false)
+
+	case "relnotes":
+		if len(os.Args) < 3 {
+			log.Print(helptext)
+			os.Exit(1)
+		}
+		relnotesCommand.Parse(os.Args[3:])
+		err = doRelNotes(relnotesCommand, fromPtr, toPtr, labelMapPtr, skipLabelPtr, relnotesFormatPtr, relnotesHostPtr, false)
+
+	case "release":
+		if len(os.Args) < 3 {
+			log.Print(helptext)
+			os.Exit(1)
+		}
+		switch os.Args[2] {
+		case "edit":
+			if len(os.Args) < 4 {
+				log.Print(helptext)
+				os.Exit(1)
+			}
+			releaseEditCommand.Parse(os.Args[4:])
+			err = doReleaseEdit(releaseEditCommand, releaseTagPtr, releaseDryRunPtr, releaseCreatePtr, releaseFromFilePtr, releaseHostPtr, false)
+		default:
+			log.Printf("Unknown release action '%s'", os.Args[2])
+			os.Exit(1)
+		}
 
 	default:
 		log.Printf("Unknown command '%s'", os.Args[1])
-		log.Println(helptext)
+		log.Print(helptext)
 		os.Exit(1)
 	}
 
@@ -206,38 +282,23 @@ func main() {
 	}
 }
 
-func getClient() (*githubv4.Client, error) {
-	usr, err := user.Current()
+/* getClient builds a githubv4 client for the given --host profile (or the
+ * default profile, if host is ""). See config.go for how ~/.ght is resolved. */
+func getClient(host string) (*githubv4.Client, error) {
+	token, endpoint, err := loadConfig(host)
 	if err != nil {
 		return nil, err
 	}
 
-	path := filepath.Join(usr.HomeDir, ".ght")
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return nil, fmt.Errorf("ght. Missing '%s' file. This should contain your GitHub Personal API token. See https://blog.github.com/2013-05-16-personal-api-tokens/", path)
+	tc := newTokenClient(token)
+	if endpoint != "" {
+		return githubv4.NewEnterpriseClient(endpoint, tc), nil
 	}
-
-	token, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("ght. Error reading file '%s', error: %s", path, err)
-	}
-
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: strings.TrimSpace(string(token))},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-
-	client := githubv4.NewClient(tc)
-	if err != nil {
-		return nil, fmt.Errorf("ght. Error creating client: %s", err)
-	}
-
-	return client, nil
+	return githubv4.NewClient(tc), nil
 }
 
 /* doListRepos displays information about all repos for a user, or for an organisation */
-func doListRepos(flags *flag.FlagSet, org *string, user *string, displayHelp bool) error {
+func doListRepos(flags *flag.FlagSet, org *string, user *string, format *string, host *string, visibility *string, affiliation *string, includeArchived *bool, language *string, topic *string, pushedSince *string, sort *string, displayHelp bool) error {
 
 	helptext := `
 ght repos 		List github repositories for an organisation or user
@@ -265,23 +326,57 @@ The arguments are:
 		return fmt.Errorf("Invalid arguments. Provide one of '-o organisation' or '-u user'")
 	}
 
-	client, err := getClient()
+	if err := validateFormat(*format); err != nil {
+		return err
+	}
+
+	repoFilters := repoListOptions{
+		Visibility:      *visibility,
+		Affiliations:    splitNonEmpty(*affiliation),
+		IncludeArchived: *includeArchived,
+		Language:        *language,
+		Topic:           *topic,
+		PushedSince:     *pushedSince,
+		Sort:            *sort,
+	}
+
+	client, err := getClient(*host)
 	if err != nil {
 		return err
 	}
 
 	var allRepos []Repository
 	if *org != "" {
-		allRepos, err = listReposByOrg(client, *org)
+		allRepos, err = listReposByOrg(client, *org, repoFilters)
 	} else if *user != "" {
-		allRepos, err = listReposByUser(client, *user)
+		allRepos, err = listReposByUser(client, *user, repoFilters)
+	}
+	if err != nil {
+		return err
 	}
+
+	allRepos, err = repoFilters.apply(allRepos)
 	if err != nil {
 		return err
 	}
+
+	if *format != formatTable {
+		return renderOutput(*format, buildReposListOutput(allRepos))
+	}
+
+	if !repoFilters.fieldsRequested() {
+		for _, r := range allRepos {
+			log.Printf("%s\n", r.NameWithOwner)
+		}
+		return nil
+	}
+
+	table := newTable()
+	table.AddRow("Name", "Visibility", "Archived", "Language", "Stars", "Pushed")
 	for _, r := range allRepos {
-		log.Printf("%s\n", r.NameWithOwner)
+		table.AddRow(r.NameWithOwner, repoVisibility(r), r.IsArchived, r.PrimaryLanguage.Name, r.StargazerCount, formatDateShort(r.PushedAt))
 	}
+	fmt.Println(table)
 	return nil
 }
 
@@ -292,7 +387,7 @@ func newTable() *uitable.Table {
 }
 
 /* doRepo displays information about one repo */
-func doRepo(flags *flag.FlagSet, maxReleases, maxTags *int, showDescription *bool, showChangelog *bool, printColor *bool, displayHelp bool) error {
+func doRepo(flags *flag.FlagSet, maxReleases, maxTags *int, showDescription *bool, showChangelog *bool, printColor *bool, format *string, host *string, displayHelp bool) error {
 
 	helptext := `
 ght repo 		Summarise a single repository
@@ -316,7 +411,11 @@ The arguments are:
 		return fmt.Errorf("Error parsing arguments")
 	}
 
-	client, err := getClient()
+	if err := validateFormat(*format); err != nil {
+		return err
+	}
+
+	client, err := getClient(*host)
 	if err != nil {
 		return err
 	}
@@ -342,6 +441,14 @@ The arguments are:
 	if err != nil {
 		return err
 	}
+
+	if *format != formatTable {
+		if *showChangelog {
+			return renderOutput(*format, buildChangelogOutput(q, *maxReleases))
+		}
+		return renderOutput(*format, buildRepoSummaryOutput(q, *maxReleases, *maxTags))
+	}
+
 	if *showChangelog {
 		return outputChangelog(q, maxReleases, printColor)
 	}
@@ -378,6 +485,28 @@ func outputChangelog(q QueryRepoDetail, maxReleases *int, printColor *bool) erro
 	return nil
 }
 
+/* renderChangelogMarkdown renders the same content as outputChangelog, but as a
+ * plain Markdown string, for use where the output isn't printed to a terminal
+ * (e.g. publishing to a GitHub Release body). */
+func renderChangelogMarkdown(q QueryRepoDetail, maxReleases int) string {
+	var b strings.Builder
+	b.WriteString("# Change Log\n\n")
+	for i, r := range q.Repository.Releases.Nodes {
+		if i >= maxReleases {
+			break
+		}
+
+		fmt.Fprintf(&b, "## %s\n\n", formatTagName(r.Tag.Name))
+		fmt.Fprintf(&b, "- %s\n", formatReleaseTitle(r.Name))
+		desc := strings.TrimSpace(strings.Replace(string(r.Description), "\n", " ", -1))
+		if desc != "" {
+			fmt.Fprintf(&b, "  - %s\n", desc)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
 func outputRepoSummary(q QueryRepoDetail, maxReleases, maxTags *int, showDescription *bool) error {
 	table := newTable()
 	table.AddRow("Repository")
@@ -479,12 +608,21 @@ func formatReleaseTitle(s githubv4.String) string {
 	return string(s)
 }
 
-func listReposByUser(client *githubv4.Client, user string) ([]Repository, error) {
+func listReposByUser(client *githubv4.Client, user string, opts repoListOptions) ([]Repository, error) {
+	privacy, affiliations, orderField, orderDirection, err := opts.queryArgs()
+	if err != nil {
+		return nil, err
+	}
+
 	ctx := context.Background()
 	var q QueryReposByUser
 	variables := map[string]interface{}{
 		"login":              githubv4.String(user),
 		"repositoriesCursor": (*githubv4.String)(nil), // Null after argument to get first page.
+		"privacy":            privacy,
+		"affiliations":       affiliations,
+		"orderField":         orderField,
+		"orderDirection":     orderDirection,
 	}
 	var allRepos []Repository
 	for {
@@ -501,12 +639,20 @@ func listReposByUser(client *githubv4.Client, user string) ([]Repository, error)
 	return allRepos, nil
 }
 
-func listReposByOrg(client *githubv4.Client, org string) ([]Repository, error) {
+func listReposByOrg(client *githubv4.Client, org string, opts repoListOptions) ([]Repository, error) {
+	privacy, _, orderField, orderDirection, err := opts.queryArgs()
+	if err != nil {
+		return nil, err
+	}
+
 	ctx := context.Background()
 	var q QueryReposByOrg
 	variables := map[string]interface{}{
 		"login":              githubv4.String(org),
 		"repositoriesCursor": (*githubv4.String)(nil), // Null after argument to get first page.
+		"privacy":            privacy,
+		"orderField":         orderField,
+		"orderDirection":     orderDirection,
 	}
 	var allRepos []Repository
 	for {
@@ -0,0 +1,225 @@
+package main
+
+/* output.go defines the structured output shapes for --format=json|yaml. These
+ * are deliberately separate from the githubv4 query structs above, so that the
+ * output shape doesn't accidentally change whenever a query's struct tags do.
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+)
+
+/* validateFormat rejects anything other than the supported --format values */
+func validateFormat(format string) error {
+	switch format {
+	case formatTable, formatJSON, formatYAML:
+		return nil
+	default:
+		return fmt.Errorf("ght. Invalid --format '%s', must be one of table, json, yaml", format)
+	}
+}
+
+/* renderOutput marshals v as JSON or YAML and prints it to stdout */
+func renderOutput(format string, v interface{}) error {
+	switch format {
+	case formatJSON:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case formatYAML:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+	default:
+		return fmt.Errorf("ght. renderOutput called with unsupported format '%s'", format)
+	}
+	return nil
+}
+
+// ReposListOutput is the --format=json|yaml shape of `ght repos`.
+type ReposListOutput struct {
+	Repositories []RepoListEntry `json:"repositories" yaml:"repositories"`
+}
+
+// RepoListEntry is a single repository in a ReposListOutput.
+type RepoListEntry struct {
+	NameWithOwner string   `json:"name_with_owner" yaml:"name_with_owner"`
+	URL           string   `json:"url" yaml:"url"`
+	Visibility    string   `json:"visibility" yaml:"visibility"`
+	IsArchived    bool     `json:"is_archived" yaml:"is_archived"`
+	IsFork        bool     `json:"is_fork" yaml:"is_fork"`
+	Language      string   `json:"language,omitempty" yaml:"language,omitempty"`
+	Stars         int      `json:"stars" yaml:"stars"`
+	PushedAt      string   `json:"pushed_at" yaml:"pushed_at"`
+	Topics        []string `json:"topics,omitempty" yaml:"topics,omitempty"`
+}
+
+// RepoSummaryOutput is the --format=json|yaml shape of `ght repo`.
+type RepoSummaryOutput struct {
+	NameWithOwner string          `json:"name_with_owner" yaml:"name_with_owner"`
+	URL           string          `json:"url" yaml:"url"`
+	DefaultBranch string          `json:"default_branch" yaml:"default_branch"`
+	Releases      []ReleaseOutput `json:"releases" yaml:"releases"`
+	Tags          []TagOutput     `json:"tags" yaml:"tags"`
+}
+
+// ReleaseOutput is a single release in a RepoSummaryOutput.
+type ReleaseOutput struct {
+	Tag         string `json:"tag" yaml:"tag"`
+	Name        string `json:"name" yaml:"name"`
+	Status      string `json:"status" yaml:"status"`
+	PublishedAt string `json:"published_at" yaml:"published_at"`
+	Author      string `json:"author" yaml:"author"`
+	URL         string `json:"url" yaml:"url"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// TagOutput is a single tag in a RepoSummaryOutput.
+type TagOutput struct {
+	Name string `json:"name" yaml:"name"`
+	Sha  string `json:"sha" yaml:"sha"`
+}
+
+// ChangelogOutput is the --format=json|yaml shape of `ght repo --changelog`.
+type ChangelogOutput struct {
+	Releases []ChangelogEntry `json:"releases" yaml:"releases"`
+}
+
+// ChangelogEntry is a single release in a ChangelogOutput.
+type ChangelogEntry struct {
+	Tag         string `json:"tag" yaml:"tag"`
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// RelNotesOutput is the --format=json|yaml shape of `ght relnotes`.
+type RelNotesOutput struct {
+	Sections []RelNotesSection `json:"sections" yaml:"sections"`
+}
+
+// RelNotesSection is a single heading's worth of notes in a RelNotesOutput.
+type RelNotesSection struct {
+	Heading string          `json:"heading" yaml:"heading"`
+	Notes   []RelNotesEntry `json:"notes" yaml:"notes"`
+}
+
+// RelNotesEntry is a single pull request's note in a RelNotesSection.
+type RelNotesEntry struct {
+	Note   string `json:"note" yaml:"note"`
+	Number int    `json:"number" yaml:"number"`
+	Author string `json:"author" yaml:"author"`
+}
+
+/* releaseStatus normalizes a Release's draft/prerelease state to a lowercase
+ * string, for use in structured output. */
+func releaseStatus(r Release) string {
+	if r.IsDraft {
+		return "draft"
+	} else if r.IsPrerelease {
+		return "prerelease"
+	}
+	return "published"
+}
+
+func buildReposListOutput(repos []Repository) ReposListOutput {
+	out := ReposListOutput{}
+	for _, r := range repos {
+		var topics []string
+		for _, t := range r.RepositoryTopics.Nodes {
+			topics = append(topics, t.Topic.Name)
+		}
+		out.Repositories = append(out.Repositories, RepoListEntry{
+			NameWithOwner: r.NameWithOwner,
+			URL:           r.Url,
+			Visibility:    repoVisibility(r),
+			IsArchived:    r.IsArchived,
+			IsFork:        r.IsFork,
+			Language:      r.PrimaryLanguage.Name,
+			Stars:         r.StargazerCount,
+			PushedAt:      r.PushedAt.Format(time.RFC3339),
+			Topics:        topics,
+		})
+	}
+	return out
+}
+
+func buildRepoSummaryOutput(q QueryRepoDetail, maxReleases, maxTags int) RepoSummaryOutput {
+	out := RepoSummaryOutput{
+		NameWithOwner: string(q.Repository.NameWithOwner),
+		URL:           string(q.Repository.Url),
+		DefaultBranch: string(q.Repository.DefaultBranchRef.Name),
+	}
+	for i, r := range q.Repository.Releases.Nodes {
+		if i >= maxReleases {
+			break
+		}
+		out.Releases = append(out.Releases, ReleaseOutput{
+			Tag:         string(r.Tag.Name),
+			Name:        string(r.Name),
+			Status:      releaseStatus(r),
+			PublishedAt: r.PublishedAt.Format(time.RFC3339),
+			Author:      string(r.Author.Login),
+			URL:         fmt.Sprintf("%s", r.Url),
+			Description: strings.TrimSpace(string(r.Description)),
+		})
+	}
+	for i, t := range q.Repository.Tags.Nodes {
+		if i >= maxTags {
+			break
+		}
+		out.Tags = append(out.Tags, TagOutput{Name: string(t.Name), Sha: string(t.Target.Oid)})
+	}
+	return out
+}
+
+func buildChangelogOutput(q QueryRepoDetail, maxReleases int) ChangelogOutput {
+	out := ChangelogOutput{}
+	for i, r := range q.Repository.Releases.Nodes {
+		if i >= maxReleases {
+			break
+		}
+		out.Releases = append(out.Releases, ChangelogEntry{
+			Tag:         string(r.Tag.Name),
+			Name:        string(r.Name),
+			Description: strings.TrimSpace(string(r.Description)),
+		})
+	}
+	return out
+}
+
+func buildRelNotesOutput(buckets map[string][]pullRequestInfo, labelMap []labelRule) RelNotesOutput {
+	headings := orderedHeadings(labelMap)
+
+	out := RelNotesOutput{}
+	for _, heading := range headings {
+		prs := buckets[heading]
+		if len(prs) == 0 {
+			continue
+		}
+		section := RelNotesSection{Heading: heading}
+		for _, pr := range prs {
+			section.Notes = append(section.Notes, RelNotesEntry{
+				Note:   releaseNote(pr),
+				Number: pr.Number,
+				Author: pr.Author,
+			})
+		}
+		out.Sections = append(out.Sections, section)
+	}
+	return out
+}
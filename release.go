@@ -0,0 +1,242 @@
+package main
+
+/* release.go implements the 'ght release edit' subcommand, which publishes a
+ * rendered changelog back to the body of a GitHub Release. This is the one
+ * place in ght that writes to GitHub rather than just reading from it.
+ *
+ * GitHub's v4 (GraphQL) schema has no mutation for creating or updating a
+ * release, so this reads via githubv4 (to validate the token and render the
+ * changelog) but writes via the v3 REST API, over the same authenticated
+ * http.Client.
+ */
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/shurcooL/githubv4"
+)
+
+// QueryViewer is used to validate that the configured token works, and to
+// surface a permissions-aware error message before attempting to write.
+type QueryViewer struct {
+	Viewer struct {
+		Login githubv4.String
+	}
+}
+
+// restRelease is the subset of a GitHub REST API release we need.
+type restRelease struct {
+	ID      int64  `json:"id"`
+	Body    string `json:"body"`
+	HTMLURL string `json:"html_url"`
+}
+
+/* doReleaseEdit publishes a rendered changelog to the body of a GitHub Release */
+func doReleaseEdit(flags *flag.FlagSet, tag *string, dryRun, create *bool, fromFile, host *string, displayHelp bool) error {
+
+	helptext := `
+ght release edit 	Publish the rendered changelog to a GitHub Release
+
+Usage:
+
+	ght release edit owner/repo --tag vX.Y.Z [arguments]
+
+The arguments are:
+`
+
+	// Asked for help?
+	if displayHelp {
+		log.Println(helptext)
+		flags.PrintDefaults()
+		return nil
+	}
+
+	// FlagSet.Parse() will evaluate to false if no flags were parsed
+	if !flags.Parsed() {
+		return fmt.Errorf("Error parsing arguments")
+	}
+
+	if *tag == "" {
+		return fmt.Errorf("Invalid arguments. --tag is required")
+	}
+
+	ownerRepo := strings.Split(os.Args[3], "/")
+	if len(ownerRepo) != 2 {
+		return fmt.Errorf("Error parsing %s as 'owner/repo'", os.Args[3])
+	}
+	owner := ownerRepo[0]
+	reponame := ownerRepo[1]
+
+	token, endpoint, err := loadConfig(*host)
+	if err != nil {
+		return err
+	}
+	httpClient := newTokenClient(token)
+
+	graphqlClient := githubv4.NewClient(httpClient)
+	if endpoint != "" {
+		graphqlClient = githubv4.NewEnterpriseClient(endpoint, httpClient)
+	}
+
+	if err := validateToken(graphqlClient); err != nil {
+		return err
+	}
+
+	newBody, err := releaseBody(graphqlClient, owner, reponame, *fromFile)
+	if err != nil {
+		return err
+	}
+
+	restBase := restBaseURL(endpoint)
+	existing, err := restGetReleaseByTag(httpClient, restBase, owner, reponame, *tag)
+	if err != nil {
+		return err
+	}
+
+	if existing == nil {
+		if !*create {
+			return fmt.Errorf("ght. No release found for tag '%s', pass --create to create one", *tag)
+		}
+		if *dryRun {
+			fmt.Printf("--- would create release %s\n+++ body\n%s\n", *tag, newBody)
+			return nil
+		}
+		created, err := restCreateRelease(httpClient, restBase, owner, reponame, *tag, newBody)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created release, see %s\n", created.HTMLURL)
+		return nil
+	}
+
+	if *dryRun {
+		fmt.Printf("--- current body\n%s\n+++ proposed body\n%s\n", existing.Body, newBody)
+		return nil
+	}
+	updated, err := restUpdateRelease(httpClient, restBase, owner, reponame, existing.ID, newBody)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Updated release, see %s\n", updated.HTMLURL)
+	return nil
+}
+
+/* releaseBody returns the Markdown to publish: the contents of fromFile if
+ * given, otherwise the rendered changelog for the repository. */
+func releaseBody(client *githubv4.Client, owner, reponame, fromFile string) (string, error) {
+	if fromFile != "" {
+		data, err := ioutil.ReadFile(fromFile)
+		if err != nil {
+			return "", fmt.Errorf("ght. Error reading '%s', error: %s", fromFile, err)
+		}
+		return string(data), nil
+	}
+
+	ctx := context.Background()
+	var q QueryRepoDetail
+	variables := map[string]interface{}{
+		"owner":       githubv4.String(owner),
+		"name":        githubv4.String(reponame),
+		"maxReleases": githubv4.Int(20),
+		"maxTags":     githubv4.Int(0),
+		"tagPrefix":   githubv4.String("refs/tags/"),
+	}
+	if err := client.Query(ctx, &q, variables); err != nil {
+		return "", err
+	}
+	return renderChangelogMarkdown(q, 20), nil
+}
+
+/* validateToken confirms the configured token is usable, surfacing a
+ * permissions-aware error message up front rather than failing deep inside a
+ * write. */
+func validateToken(client *githubv4.Client) error {
+	ctx := context.Background()
+	var q QueryViewer
+	if err := client.Query(ctx, &q, nil); err != nil {
+		return fmt.Errorf("ght. Error validating token, ensure it has 'repo' or 'public_repo' scope: %s", err)
+	}
+	return nil
+}
+
+/* restBaseURL derives the REST v3 API base from the configured GraphQL
+ * endpoint, or the public API if none is configured. */
+func restBaseURL(graphqlEndpoint string) string {
+	if graphqlEndpoint == "" {
+		return "https://api.github.com"
+	}
+	return strings.TrimSuffix(graphqlEndpoint, "/api/graphql") + "/api/v3"
+}
+
+/* restGetReleaseByTag returns the release for a tag, or nil if none exists */
+func restGetReleaseByTag(httpClient *http.Client, base, owner, reponame, tag string) (*restRelease, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/releases/tags/%s", base, owner, reponame, tag)
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("ght. Error fetching release '%s': %s", tag, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ght. Error fetching release '%s', status %s", tag, resp.Status)
+	}
+
+	var release restRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, fmt.Errorf("ght. Error decoding release '%s': %s", tag, err)
+	}
+	return &release, nil
+}
+
+func restUpdateRelease(httpClient *http.Client, base, owner, reponame string, id int64, body string) (*restRelease, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/releases/%d", base, owner, reponame, id)
+	return restSendRelease(httpClient, http.MethodPatch, url, map[string]string{"body": body})
+}
+
+func restCreateRelease(httpClient *http.Client, base, owner, reponame, tag, body string) (*restRelease, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/releases", base, owner, reponame)
+	return restSendRelease(httpClient, http.MethodPost, url, map[string]string{"tag_name": tag, "body": body})
+}
+
+func restSendRelease(httpClient *http.Client, method, url string, payload map[string]string) (*restRelease, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ght. Error %s %s: %s", method, url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("ght. %s %s returned status %s: %s", method, url, resp.Status, string(body))
+	}
+
+	var release restRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, fmt.Errorf("ght. Error decoding response from %s %s: %s", method, url, err)
+	}
+	return &release, nil
+}
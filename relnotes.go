@@ -0,0 +1,416 @@
+package main
+
+/* relnotes.go implements the 'ght relnotes' subcommand, which drafts a categorised
+ * release notes document by walking the pull requests merged between two refs,
+ * similar to the Kubernetes 'relnotes' toolbox.
+ */
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/shurcooL/githubv4"
+	"gopkg.in/yaml.v3"
+)
+
+// labelRule maps a single PR label to a release-notes heading. Rules are tried
+// in order, so the first matching label wins.
+type labelRule struct {
+	Label   string `yaml:"label"`
+	Heading string `yaml:"heading"`
+}
+
+// defaultLabelMap is used when the user does not supply --label-map.
+var defaultLabelMap = []labelRule{
+	{Label: "kind/feature", Heading: "Features"},
+	{Label: "kind/bug", Heading: "Bug Fixes"},
+	{Label: "kind/deprecation", Heading: "Deprecations"},
+	{Label: "kind/api-change", Heading: "API Changes"},
+}
+
+// otherChangesHeading buckets any PR whose labels don't match a rule.
+const otherChangesHeading = "Other Changes"
+
+// QueryRefOid resolves a ref expression (tag, branch or commit-ish) to the OID
+// of the commit it points at.
+type QueryRefOid struct {
+	Repository struct {
+		Object struct {
+			Commit struct {
+				Oid githubv4.String
+			} `graphql:"... on Commit"`
+		} `graphql:"object(expression: $expression)"`
+	} `graphql:"repository(owner: $owner, name: $name)"`
+}
+
+// QueryDefaultBranch resolves the name of a repository's default branch, used
+// when --to is not supplied.
+type QueryDefaultBranch struct {
+	Repository struct {
+		DefaultBranchRef struct {
+			Name githubv4.String
+		}
+	} `graphql:"repository(owner: $owner, name: $name)"`
+}
+
+// associatedPullRequestNode is the raw GraphQL shape of a commit's associated
+// pull request, before filtering to merged PRs and flattening into a
+// pullRequestInfo.
+type associatedPullRequestNode struct {
+	Number githubv4.Int
+	Title  githubv4.String
+	Body   githubv4.String
+	State  githubv4.PullRequestState
+	Author struct {
+		Login githubv4.String
+	}
+	Labels struct {
+		Nodes []struct {
+			Name githubv4.String
+		}
+	} `graphql:"labels(first: 10)"`
+}
+
+// QueryCommitRange walks the commit history reachable from $expression (a
+// single commit-ish, the top of the range), returning each commit's
+// associated pull request. pullRequestsInRange stops paging once it reaches
+// the "from" OID resolved via QueryRefOid, so the two together emulate the
+// "A..B" range GitHub's GraphQL API has no direct equivalent for.
+type QueryCommitRange struct {
+	Repository struct {
+		Object struct {
+			Commit struct {
+				History struct {
+					Nodes []struct {
+						Oid                    githubv4.String
+						AssociatedPullRequests struct {
+							Nodes []associatedPullRequestNode
+						} `graphql:"associatedPullRequests(first: 1)"`
+					}
+					PageInfo struct {
+						EndCursor   githubv4.String
+						HasNextPage bool
+					}
+				} `graphql:"history(first: 100, after: $historyCursor)"`
+			} `graphql:"... on Commit"`
+		} `graphql:"object(expression: $expression)"`
+	} `graphql:"repository(owner: $owner, name: $name)"`
+}
+
+// pullRequestInfo is the subset of a merged PR we need to draft a note.
+type pullRequestInfo struct {
+	Number int
+	Title  string
+	Body   string
+	Author string
+	Labels []string
+}
+
+/* mergedPullRequestInfo flattens a commit's associated pull request nodes
+ * into a pullRequestInfo, returning ok=false if the commit has no associated
+ * pull request or its first associated pull request was closed without
+ * being merged. */
+func mergedPullRequestInfo(nodes []associatedPullRequestNode) (pullRequestInfo, bool) {
+	if len(nodes) == 0 {
+		return pullRequestInfo{}, false
+	}
+	pr := nodes[0]
+	if pr.State != githubv4.PullRequestStateMerged {
+		return pullRequestInfo{}, false
+	}
+
+	var labels []string
+	for _, l := range pr.Labels.Nodes {
+		labels = append(labels, string(l.Name))
+	}
+	return pullRequestInfo{
+		Number: int(pr.Number),
+		Title:  string(pr.Title),
+		Body:   string(pr.Body),
+		Author: string(pr.Author.Login),
+		Labels: labels,
+	}, true
+}
+
+/* doRelNotes drafts release notes for the pull requests merged between two refs */
+func doRelNotes(flags *flag.FlagSet, from, to, labelMapPath, skipLabels, format, host *string, displayHelp bool) error {
+
+	helptext := `
+ght relnotes 		Draft release notes between two tags, grouped by PR labels
+
+Usage:
+
+	ght relnotes owner/repo --from <tagA> [--to <tagB>]
+
+The arguments are:
+`
+
+	// Asked for help?
+	if displayHelp {
+		log.Println(helptext)
+		flags.PrintDefaults()
+		return nil
+	}
+
+	// FlagSet.Parse() will evaluate to false if no flags were parsed
+	if !flags.Parsed() {
+		return fmt.Errorf("Error parsing arguments")
+	}
+
+	if *from == "" {
+		return fmt.Errorf("Invalid arguments. --from is required")
+	}
+
+	if err := validateFormat(*format); err != nil {
+		return err
+	}
+
+	ownerRepo := strings.Split(os.Args[2], "/")
+	if len(ownerRepo) != 2 {
+		return fmt.Errorf("Error parsing %s as 'owner/repo'", os.Args[2])
+	}
+	owner := ownerRepo[0]
+	reponame := ownerRepo[1]
+
+	client, err := getClient(*host)
+	if err != nil {
+		return err
+	}
+
+	labelMap := defaultLabelMap
+	if *labelMapPath != "" {
+		labelMap, err = loadLabelMap(*labelMapPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	skip := map[string]bool{}
+	for _, l := range strings.Split(*skipLabels, ",") {
+		l = strings.TrimSpace(l)
+		if l != "" {
+			skip[l] = true
+		}
+	}
+
+	toRef := *to
+	if toRef == "" {
+		toRef, err = defaultBranch(client, owner, reponame)
+		if err != nil {
+			return err
+		}
+	}
+
+	prs, err := pullRequestsInRange(client, owner, reponame, *from, toRef)
+	if err != nil {
+		return err
+	}
+
+	buckets := bucketPullRequests(prs, labelMap, skip)
+
+	if *format != formatTable {
+		return renderOutput(*format, buildRelNotesOutput(buckets, labelMap))
+	}
+
+	fmt.Print(renderReleaseNotes(buckets, labelMap))
+	return nil
+}
+
+/* loadLabelMap reads an ordered list of label->heading rules from a YAML file */
+func loadLabelMap(path string) ([]labelRule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ght. Error reading label map '%s', error: %s", path, err)
+	}
+	var rules []labelRule
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("ght. Error parsing label map '%s', error: %s", path, err)
+	}
+	return rules, nil
+}
+
+/* defaultBranch returns the name of the repository's default branch */
+func defaultBranch(client *githubv4.Client, owner, name string) (string, error) {
+	ctx := context.Background()
+	var q QueryDefaultBranch
+	variables := map[string]interface{}{
+		"owner": githubv4.String(owner),
+		"name":  githubv4.String(name),
+	}
+	if err := client.Query(ctx, &q, variables); err != nil {
+		return "", err
+	}
+	return string(q.Repository.DefaultBranchRef.Name), nil
+}
+
+/* commitOid resolves a ref expression (tag, branch or commit-ish) to the OID
+ * of the commit it points at, via QueryRefOid. */
+func commitOid(client *githubv4.Client, owner, name, expression string) (string, error) {
+	ctx := context.Background()
+	var q QueryRefOid
+	variables := map[string]interface{}{
+		"owner":      githubv4.String(owner),
+		"name":       githubv4.String(name),
+		"expression": githubv4.String(expression),
+	}
+	if err := client.Query(ctx, &q, variables); err != nil {
+		return "", err
+	}
+	return string(q.Repository.Object.Commit.Oid), nil
+}
+
+/* pullRequestsInRange walks "to"'s commit history, stopping once it reaches
+ * "from"'s OID, and returns the distinct merged pull requests associated
+ * with the commits in between - GitHub's GraphQL API has no "A..B" range
+ * expression, so the range is emulated by resolving "from" up front and
+ * cutting the walk short when it's reached. Commits with no associated PR,
+ * and commits whose associated PR was closed without being merged, are
+ * skipped. */
+func pullRequestsInRange(client *githubv4.Client, owner, name, from, to string) ([]pullRequestInfo, error) {
+	fromOid, err := commitOid(client, owner, name, from)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	var q QueryCommitRange
+	variables := map[string]interface{}{
+		"owner":         githubv4.String(owner),
+		"name":          githubv4.String(name),
+		"expression":    githubv4.String(to),
+		"historyCursor": (*githubv4.String)(nil),
+	}
+
+	seen := map[int]bool{}
+	var prs []pullRequestInfo
+	for {
+		if err := client.Query(ctx, &q, variables); err != nil {
+			return nil, err
+		}
+		for _, c := range q.Repository.Object.Commit.History.Nodes {
+			if string(c.Oid) == fromOid {
+				return prs, nil
+			}
+			pr, ok := mergedPullRequestInfo(c.AssociatedPullRequests.Nodes)
+			if !ok || seen[pr.Number] {
+				continue
+			}
+			seen[pr.Number] = true
+			prs = append(prs, pr)
+		}
+		if !q.Repository.Object.Commit.History.PageInfo.HasNextPage {
+			break
+		}
+		variables["historyCursor"] = githubv4.NewString(q.Repository.Object.Commit.History.PageInfo.EndCursor)
+	}
+	return prs, nil
+}
+
+/* bucketPullRequests groups PRs under a heading, using the first label rule that
+ * matches (in map order), falling back to otherChangesHeading. PRs carrying a
+ * skip label are dropped entirely. */
+func bucketPullRequests(prs []pullRequestInfo, labelMap []labelRule, skip map[string]bool) map[string][]pullRequestInfo {
+	buckets := map[string][]pullRequestInfo{}
+	for _, pr := range prs {
+		skipped := false
+		for _, l := range pr.Labels {
+			if skip[l] {
+				skipped = true
+				break
+			}
+		}
+		if skipped {
+			continue
+		}
+
+		heading := otherChangesHeading
+		for _, rule := range labelMap {
+			if hasLabel(pr.Labels, rule.Label) {
+				heading = rule.Heading
+				break
+			}
+		}
+		buckets[heading] = append(buckets[heading], pr)
+	}
+	for heading := range buckets {
+		sort.Slice(buckets[heading], func(i, j int) bool {
+			return buckets[heading][i].Number < buckets[heading][j].Number
+		})
+	}
+	return buckets
+}
+
+func hasLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+/* releaseNote extracts the note for a PR from a ```release-note fenced block in
+ * its body, falling back to the PR title if the block is missing or says
+ * NONE. */
+func releaseNote(pr pullRequestInfo) string {
+	const fence = "```release-note"
+	start := strings.Index(pr.Body, fence)
+	if start == -1 {
+		return pr.Title
+	}
+	rest := pr.Body[start+len(fence):]
+	end := strings.Index(rest, "```")
+	if end == -1 {
+		return pr.Title
+	}
+	note := strings.TrimSpace(rest[:end])
+	if strings.EqualFold(note, "NONE") || note == "" {
+		return pr.Title
+	}
+	return note
+}
+
+/* orderedHeadings returns the distinct headings implied by labelMap, in
+ * first-seen order, followed by otherChangesHeading. A --label-map that
+ * points two labels at the same heading must not render that heading twice. */
+func orderedHeadings(labelMap []labelRule) []string {
+	seen := map[string]bool{}
+	var headings []string
+	add := func(heading string) {
+		if !seen[heading] {
+			seen[heading] = true
+			headings = append(headings, heading)
+		}
+	}
+	for _, rule := range labelMap {
+		add(rule.Heading)
+	}
+	add(otherChangesHeading)
+	return headings
+}
+
+/* renderReleaseNotes renders the bucketed PRs as Markdown, in label-map order
+ * followed by Other Changes. */
+func renderReleaseNotes(buckets map[string][]pullRequestInfo, labelMap []labelRule) string {
+	headings := orderedHeadings(labelMap)
+
+	var b strings.Builder
+	for _, heading := range headings {
+		prs := buckets[heading]
+		if len(prs) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "## %s\n\n", heading)
+		for _, pr := range prs {
+			fmt.Fprintf(&b, "- %s (#%d, @%s)\n", releaseNote(pr), pr.Number, pr.Author)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
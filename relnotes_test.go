@@ -0,0 +1,181 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shurcooL/githubv4"
+)
+
+func TestReleaseNote(t *testing.T) {
+	cases := []struct {
+		name string
+		pr   pullRequestInfo
+		want string
+	}{
+		{
+			name: "fenced note",
+			pr:   pullRequestInfo{Title: "Add widget", Body: "Intro\n```release-note\nAdds the widget API\n```\nmore text"},
+			want: "Adds the widget API",
+		},
+		{
+			name: "NONE falls back to title",
+			pr:   pullRequestInfo{Title: "Refactor internals", Body: "```release-note\nNONE\n```"},
+			want: "Refactor internals",
+		},
+		{
+			name: "empty block falls back to title",
+			pr:   pullRequestInfo{Title: "Tidy tests", Body: "```release-note\n\n```"},
+			want: "Tidy tests",
+		},
+		{
+			name: "no fenced block falls back to title",
+			pr:   pullRequestInfo{Title: "Bump dependency", Body: "Just bumps a dependency, no note block here."},
+			want: "Bump dependency",
+		},
+		{
+			name: "unterminated block falls back to title",
+			pr:   pullRequestInfo{Title: "WIP change", Body: "```release-note\nno closing fence"},
+			want: "WIP change",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := releaseNote(c.pr); got != c.want {
+				t.Errorf("releaseNote() = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestHasLabel(t *testing.T) {
+	cases := []struct {
+		name   string
+		labels []string
+		label  string
+		want   bool
+	}{
+		{name: "present", labels: []string{"kind/bug", "priority/high"}, label: "kind/bug", want: true},
+		{name: "absent", labels: []string{"kind/bug"}, label: "kind/feature", want: false},
+		{name: "empty labels", labels: nil, label: "kind/bug", want: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := hasLabel(c.labels, c.label); got != c.want {
+				t.Errorf("hasLabel(%v, %q) = %v, want %v", c.labels, c.label, got, c.want)
+			}
+		})
+	}
+}
+
+func TestBucketPullRequests(t *testing.T) {
+	labelMap := []labelRule{
+		{Label: "kind/feature", Heading: "Features"},
+		{Label: "kind/bug", Heading: "Bug Fixes"},
+	}
+
+	prs := []pullRequestInfo{
+		{Number: 2, Labels: []string{"kind/bug", "kind/feature"}},
+		{Number: 1, Labels: []string{"kind/feature"}},
+		{Number: 3, Labels: []string{"release-note-none"}},
+		{Number: 4, Labels: []string{"documentation"}},
+	}
+
+	buckets := bucketPullRequests(prs, labelMap, map[string]bool{"release-note-none": true})
+
+	// #2 carries both "kind/feature" and "kind/bug"; "kind/feature" is first
+	// in labelMap so it wins, and within the bucket PRs are sorted by number.
+	wantFeatures := []int{1, 2}
+	var gotFeatures []int
+	for _, pr := range buckets["Features"] {
+		gotFeatures = append(gotFeatures, pr.Number)
+	}
+	if !reflect.DeepEqual(gotFeatures, wantFeatures) {
+		t.Errorf("Features bucket = %v, want %v", gotFeatures, wantFeatures)
+	}
+
+	if len(buckets["Bug Fixes"]) != 0 {
+		t.Errorf("Bug Fixes bucket = %v, want empty (kind/feature matched first)", buckets["Bug Fixes"])
+	}
+
+	// #3 carries a skip label, so it must be dropped entirely.
+	for heading, prs := range buckets {
+		for _, pr := range prs {
+			if pr.Number == 3 {
+				t.Errorf("PR #3 should have been skipped, found in bucket %q", heading)
+			}
+		}
+	}
+
+	// #4 matches no rule, so it falls into Other Changes.
+	if len(buckets[otherChangesHeading]) != 1 || buckets[otherChangesHeading][0].Number != 4 {
+		t.Errorf("%s bucket = %v, want [#4]", otherChangesHeading, buckets[otherChangesHeading])
+	}
+}
+
+func TestOrderedHeadings(t *testing.T) {
+	// kind/regression maps to the same heading as kind/bug, so it must not
+	// produce a duplicate "Bug Fixes" entry.
+	labelMap := []labelRule{
+		{Label: "kind/bug", Heading: "Bug Fixes"},
+		{Label: "kind/regression", Heading: "Bug Fixes"},
+		{Label: "kind/feature", Heading: "Features"},
+	}
+
+	want := []string{"Bug Fixes", "Features", otherChangesHeading}
+	got := orderedHeadings(labelMap)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("orderedHeadings() = %v, want %v", got, want)
+	}
+}
+
+func TestMergedPullRequestInfo(t *testing.T) {
+	t.Run("no associated pull request", func(t *testing.T) {
+		_, ok := mergedPullRequestInfo(nil)
+		if ok {
+			t.Errorf("mergedPullRequestInfo(nil) ok = true, want false")
+		}
+	})
+
+	t.Run("associated pull request not merged", func(t *testing.T) {
+		nodes := []associatedPullRequestNode{{
+			Number: 42,
+			Title:  "Open PR",
+			State:  githubv4.PullRequestStateOpen,
+		}}
+		_, ok := mergedPullRequestInfo(nodes)
+		if ok {
+			t.Errorf("mergedPullRequestInfo() ok = true for an open PR, want false")
+		}
+	})
+
+	t.Run("associated pull request merged", func(t *testing.T) {
+		node := associatedPullRequestNode{
+			Number: 42,
+			Title:  "Add widget",
+			Body:   "```release-note\nAdds the widget API\n```",
+			State:  githubv4.PullRequestStateMerged,
+		}
+		node.Author.Login = "octocat"
+		node.Labels.Nodes = []struct {
+			Name githubv4.String
+		}{{Name: "kind/feature"}}
+
+		got, ok := mergedPullRequestInfo([]associatedPullRequestNode{node})
+		if !ok {
+			t.Fatalf("mergedPullRequestInfo() ok = false for a merged PR, want true")
+		}
+		want := pullRequestInfo{
+			Number: 42,
+			Title:  "Add widget",
+			Body:   "```release-note\nAdds the widget API\n```",
+			Author: "octocat",
+			Labels: []string{"kind/feature"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("mergedPullRequestInfo() = %+v, want %+v", got, want)
+		}
+	})
+}
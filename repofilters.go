@@ -0,0 +1,143 @@
+package main
+
+/* repofilters.go implements the `ght repos` filtering and sorting flags:
+ * --visibility, --affiliation, --include-archived, --language, --topic,
+ * --pushed-since and --sort. Filters GitHub's repositories connection exposes
+ * natively (visibility, affiliation, ordering) are pushed to the server;
+ * the rest are applied client-side after pagination.
+ */
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shurcooL/githubv4"
+)
+
+// repoListOptions bundles the `ght repos` filtering and sorting flags.
+type repoListOptions struct {
+	Visibility      string
+	Affiliations    []string
+	IncludeArchived bool
+	Language        string
+	Topic           string
+	PushedSince     string
+	Sort            string
+}
+
+/* queryArgs resolves the options into the githubv4 variables the repositories
+ * connection accepts natively. */
+func (o repoListOptions) queryArgs() (privacy *githubv4.RepositoryPrivacy, affiliations []githubv4.RepositoryAffiliation, orderField githubv4.RepositoryOrderField, orderDirection githubv4.OrderDirection, err error) {
+	switch o.Visibility {
+	case "", "all":
+		privacy = nil
+	case "public":
+		v := githubv4.RepositoryPrivacyPublic
+		privacy = &v
+	case "private":
+		v := githubv4.RepositoryPrivacyPrivate
+		privacy = &v
+	default:
+		err = fmt.Errorf("ght. Invalid --visibility '%s', must be one of all, public, private", o.Visibility)
+		return
+	}
+
+	for _, a := range o.Affiliations {
+		switch a {
+		case "owner":
+			affiliations = append(affiliations, githubv4.RepositoryAffiliationOwner)
+		case "collaborator":
+			affiliations = append(affiliations, githubv4.RepositoryAffiliationCollaborator)
+		case "organization_member":
+			affiliations = append(affiliations, githubv4.RepositoryAffiliationOrganizationMember)
+		default:
+			err = fmt.Errorf("ght. Invalid --affiliation '%s', must be a comma separated list of owner, collaborator, organization_member", a)
+			return
+		}
+	}
+
+	switch o.Sort {
+	case "", "name":
+		orderField, orderDirection = githubv4.RepositoryOrderFieldName, githubv4.OrderDirectionAsc
+	case "pushed":
+		orderField, orderDirection = githubv4.RepositoryOrderFieldPushedAt, githubv4.OrderDirectionDesc
+	case "stars":
+		orderField, orderDirection = githubv4.RepositoryOrderFieldStargazers, githubv4.OrderDirectionDesc
+	default:
+		err = fmt.Errorf("ght. Invalid --sort '%s', must be one of name, pushed, stars", o.Sort)
+		return
+	}
+	return
+}
+
+/* fieldsRequested reports whether any filtering or sorting flag was set to a
+ * non-default value, i.e. the user asked for more than the plain repo list. */
+func (o repoListOptions) fieldsRequested() bool {
+	return o.Visibility != "" && o.Visibility != "all" ||
+		len(o.Affiliations) > 0 ||
+		o.IncludeArchived ||
+		o.Language != "" ||
+		o.Topic != "" ||
+		o.PushedSince != "" ||
+		o.Sort != "" && o.Sort != "name"
+}
+
+/* apply filters repos by the options GitHub doesn't filter server-side:
+ * archived state, primary language, topic and pushed-since date. */
+func (o repoListOptions) apply(repos []Repository) ([]Repository, error) {
+	var since time.Time
+	if o.PushedSince != "" {
+		var err error
+		since, err = time.Parse("2006-01-02", o.PushedSince)
+		if err != nil {
+			return nil, fmt.Errorf("ght. Invalid --pushed-since '%s', expected YYYY-MM-DD: %s", o.PushedSince, err)
+		}
+	}
+
+	var out []Repository
+	for _, r := range repos {
+		if !o.IncludeArchived && r.IsArchived {
+			continue
+		}
+		if o.Language != "" && !strings.EqualFold(r.PrimaryLanguage.Name, o.Language) {
+			continue
+		}
+		if o.Topic != "" && !hasTopic(r, o.Topic) {
+			continue
+		}
+		if !since.IsZero() && r.PushedAt.Before(since.Local()) {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func hasTopic(r Repository, topic string) bool {
+	for _, t := range r.RepositoryTopics.Nodes {
+		if strings.EqualFold(t.Topic.Name, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+func repoVisibility(r Repository) string {
+	if r.IsPrivate {
+		return "private"
+	}
+	return "public"
+}
+
+/* splitNonEmpty splits a comma separated flag value, dropping empty entries */
+func splitNonEmpty(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}